@@ -0,0 +1,198 @@
+package driver
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// FieldType is the primitive type of a single task configuration field.
+type FieldType string
+
+const (
+	FieldTypeString FieldType = "string"
+	FieldTypeBool   FieldType = "bool"
+	FieldTypeInt    FieldType = "int"
+	FieldTypeFloat  FieldType = "float"
+	FieldTypeArray  FieldType = "array"
+	FieldTypeMap    FieldType = "map"
+)
+
+// validate reports whether v decodes to the field's declared type.
+func (t FieldType) validate(v interface{}) error {
+	switch t {
+	case FieldTypeString:
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("expected string, got %T", v)
+		}
+	case FieldTypeBool:
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("expected bool, got %T", v)
+		}
+	case FieldTypeInt:
+		switch n := v.(type) {
+		case int, int64:
+		case float64:
+			if n != math.Trunc(n) {
+				return fmt.Errorf("expected int, got non-integral number %v", n)
+			}
+		default:
+			return fmt.Errorf("expected int, got %T", v)
+		}
+	case FieldTypeFloat:
+		switch v.(type) {
+		case float32, float64:
+		default:
+			return fmt.Errorf("expected float, got %T", v)
+		}
+	case FieldTypeArray:
+		if _, ok := v.([]interface{}); !ok {
+			return fmt.Errorf("expected array, got %T", v)
+		}
+	case FieldTypeMap:
+		if _, ok := v.(map[string]interface{}); !ok {
+			return fmt.Errorf("expected map, got %T", v)
+		}
+	default:
+		return fmt.Errorf("unknown field type %q", t)
+	}
+	return nil
+}
+
+// ConfigField describes one field of a driver's task configuration block.
+type ConfigField struct {
+	// Type is the primitive type the field must decode to.
+	Type FieldType
+
+	// Required indicates the field must be set for the task config to be valid.
+	Required bool
+
+	// Fingerprintable indicates the field's value is also used when
+	// fingerprinting the driver on a node, rather than purely describing a
+	// task's runtime behavior.
+	Fingerprintable bool
+}
+
+// ConfigSchema is a pure-Go description of a driver's task configuration
+// block, keyed by field name. It deliberately has no dependency on the
+// driver's runtime (os/exec, cgo-linked fingerprinters, go-plugin), so it
+// can be registered and consulted without instantiating a real Driver.
+type ConfigSchema map[string]*ConfigField
+
+// DriverCapabilities describes what a driver supports, derived from its
+// registered schema rather than from a live Driver instance.
+type DriverCapabilities struct {
+	// Schema is the driver's task config schema.
+	Schema ConfigSchema
+}
+
+// FingerprintFields returns the names of config fields that participate in
+// node fingerprinting, sorted for stable output.
+func (c *DriverCapabilities) FingerprintFields() []string {
+	fields := make([]string, 0, len(c.Schema))
+	for name, field := range c.Schema {
+		if field.Fingerprintable {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// driverSchemas holds the schema each driver registers at init time via
+// RegisterDriverSchema. It backs ValidateTaskConfig and Capabilities so that
+// consumers can validate task blocks without instantiating a Driver. It lives
+// in the same package as the executor-launching code in utils.go, so
+// importing this package still links that code.
+var driverSchemas = map[string]ConfigSchema{}
+
+// RegisterDriverSchema registers a driver's pure-Go config schema under
+// driverName, replacing any schema already registered under that name. The
+// built-in drivers' schemas are registered by this file's init function.
+func RegisterDriverSchema(driverName string, schema ConfigSchema) {
+	driverSchemas[driverName] = schema
+}
+
+// Capabilities returns the registered DriverCapabilities for driverName. It
+// returns an error if no driver has registered a schema under that name.
+func Capabilities(driverName string) (*DriverCapabilities, error) {
+	schema, ok := driverSchemas[driverName]
+	if !ok {
+		return nil, fmt.Errorf("no capabilities registered for driver %q", driverName)
+	}
+	return &DriverCapabilities{Schema: schema}, nil
+}
+
+// ValidateTaskConfig validates cfg against driverName's registered schema
+// without instantiating a real Driver via NewDriver. It does not itself use
+// os/exec or go-plugin, but this package's utils.go imports both, so a
+// caller importing this package links them as well.
+//
+// It does not reject fields absent from the schema: the schemas registered
+// below only cover each driver's most commonly used fields, not its full
+// config block, so rejecting unknown fields here would fail currently-valid
+// task configs. Once a driver's schema is complete, its own Driver.Validate
+// is the place to enforce that, not this shared helper.
+func ValidateTaskConfig(driverName string, cfg map[string]interface{}) error {
+	schema, ok := driverSchemas[driverName]
+	if !ok {
+		return fmt.Errorf("no schema registered for driver %q", driverName)
+	}
+
+	for name, field := range schema {
+		v, set := cfg[name]
+		if !set {
+			if field.Required {
+				return fmt.Errorf("%q: field %q is required", driverName, name)
+			}
+			continue
+		}
+
+		if err := field.Type.validate(v); err != nil {
+			return fmt.Errorf("%q: field %q: %v", driverName, name, err)
+		}
+	}
+
+	return nil
+}
+
+// init registers the task config schema for each built-in driver. This is
+// the registration point Driver.Validate implementations delegate to, so
+// that jobspec and other consumers can validate task blocks for these
+// drivers without instantiating the drivers themselves.
+func init() {
+	RegisterDriverSchema("raw_exec", ConfigSchema{
+		"command": {Type: FieldTypeString, Required: true},
+		"args":    {Type: FieldTypeArray},
+	})
+
+	RegisterDriverSchema("exec", ConfigSchema{
+		"command": {Type: FieldTypeString, Required: true},
+		"args":    {Type: FieldTypeArray},
+	})
+
+	RegisterDriverSchema("java", ConfigSchema{
+		"jar_path":    {Type: FieldTypeString, Required: true},
+		"args":        {Type: FieldTypeArray},
+		"jvm_options": {Type: FieldTypeArray},
+		"class":       {Type: FieldTypeString},
+		"class_path":  {Type: FieldTypeString},
+	})
+
+	RegisterDriverSchema("docker", ConfigSchema{
+		"image":        {Type: FieldTypeString, Required: true, Fingerprintable: true},
+		"command":      {Type: FieldTypeString},
+		"args":         {Type: FieldTypeArray},
+		"network_mode": {Type: FieldTypeString},
+		"port_map":     {Type: FieldTypeMap},
+		"volumes":      {Type: FieldTypeArray},
+		"privileged":   {Type: FieldTypeBool},
+	})
+
+	RegisterDriverSchema("qemu", ConfigSchema{
+		"image_path":        {Type: FieldTypeString, Required: true},
+		"accelerator":       {Type: FieldTypeString, Fingerprintable: true},
+		"args":              {Type: FieldTypeArray},
+		"graceful_shutdown": {Type: FieldTypeBool},
+	})
+}
@@ -1,13 +1,16 @@
 package driver
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/hashicorp/consul-template/signals"
@@ -29,25 +32,76 @@ func cgroupsMounted(node *structs.Node) bool {
 	return ok
 }
 
-// createExecutor launches an executor plugin and returns an instance of the
-// Executor interface
-func createExecutor(w io.Writer, clientConfig *config.Config,
-	executorConfig *pexecutor.ExecutorConfig) (executor.Executor, *plugin.Client, error) {
+// ExecutorKillConfig carries the task's configured kill signal and desired
+// kill timeout, threaded through createExecutor so that whatever tears the
+// executor down can escalate gracefully instead of SIGKILLing immediately.
+// The operator's MaxKillTimeout is applied on top of DesiredTimeout by
+// GetKillTimeout inside destroyPlugin.
+type ExecutorKillConfig struct {
+	Signal         os.Signal
+	DesiredTimeout time.Duration
+}
+
+// ExecutorHandle bundles everything needed to manage a launched executor
+// plugin process: the RPC client itself, the pid of the plugin process, the
+// kill signal/timeout to use when tearing it down, and the ReattachConfig
+// to persist into driver handle state so the process can be reattached
+// instead of killed across a Nomad client restart.
+//
+// A driver's handle is responsible for the other half of that contract: on
+// launch it must persist handle.Reattach into whatever it serializes as its
+// DriverState, and its Open/RestoreState path must call ReattachOrDestroy
+// with that persisted value before falling back to createExecutor.
+type ExecutorHandle struct {
+	Executor  executor.Executor
+	Client    *plugin.Client
+	PluginPid int
+	Kill      *ExecutorKillConfig
+	Reattach  *ReattachConfig
+
+	closeLog func()
+}
+
+// Destroy kills the executor plugin immediately and terminates the given user
+// process pid by sending it Kill.Signal and waiting up to Kill.DesiredTimeout
+// -- bounded by maxKillTimeout via GetKillTimeout -- before escalating to
+// SIGKILL. It also
+// stops the background goroutine bridging the executor's log output.
+func (h *ExecutorHandle) Destroy(userPid int, maxKillTimeout time.Duration) error {
+	defer h.closeLog()
+	return destroyPlugin(h.PluginPid, userPid, h.Kill.Signal, h.Kill.DesiredTimeout, maxKillTimeout)
+}
+
+// createExecutor launches an executor plugin and returns a handle to it.
+// Output written by the executor subprocess on stdout and stderr is decoded
+// as JSON-formatted hclog entries and re-emitted through logger, preserving
+// the original level and tagging each line with the task name and alloc ID.
+func createExecutor(logger hclog.Logger, allocID string, task *structs.Task, clientConfig *config.Config,
+	executorConfig *pexecutor.ExecutorConfig) (*ExecutorHandle, error) {
+
+	killSignal, err := getTaskKillSignal(task.KillSignal)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kill signal: %v", err)
+	}
 
 	c, err := json.Marshal(executorConfig)
 	if err != nil {
-		return nil, nil, fmt.Errorf("unable to create executor config: %v", err)
+		return nil, fmt.Errorf("unable to create executor config: %v", err)
 	}
 	bin, err := discover.NomadExecutable()
 	if err != nil {
-		return nil, nil, fmt.Errorf("unable to find the nomad binary: %v", err)
+		return nil, fmt.Errorf("unable to find the nomad binary: %v", err)
 	}
 
+	stdout, stderr, closeLog := executorLogWriters(logger, task.Name, allocID)
+
 	config := &plugin.ClientConfig{
-		Cmd: exec.Command(bin, "executor", string(c)),
+		Cmd:        exec.Command(bin, "executor", string(c)),
+		SyncStdout: stdout,
+		SyncStderr: stderr,
 	}
 	config.HandshakeConfig = pexecutor.HandshakeConfig
-	config.Plugins = pexecutor.GetPluginMap(w, hclog.LevelFromString(clientConfig.LogLevel), executorConfig.FSIsolation)
+	config.Plugins = pexecutor.GetPluginMap(stdout, hclog.LevelFromString(clientConfig.LogLevel), executorConfig.FSIsolation)
 	config.MaxPort = clientConfig.ClientMaxPort
 	config.MinPort = clientConfig.ClientMinPort
 
@@ -60,39 +114,275 @@ func createExecutor(w io.Writer, clientConfig *config.Config,
 	executorClient := plugin.NewClient(config)
 	rpcClient, err := executorClient.Client()
 	if err != nil {
-		return nil, nil, fmt.Errorf("error creating rpc client for executor plugin: %v", err)
+		closeLog()
+		return nil, fmt.Errorf("error creating rpc client for executor plugin: %v", err)
 	}
 
 	raw, err := rpcClient.Dispense("executor")
 	if err != nil {
-		return nil, nil, fmt.Errorf("unable to dispense the executor plugin: %v", err)
+		closeLog()
+		return nil, fmt.Errorf("unable to dispense the executor plugin: %v", err)
 	}
 	executorPlugin := raw.(executor.Executor)
-	return executorPlugin, executorClient, nil
+
+	var pluginPid int
+	if config.Cmd.Process != nil {
+		pluginPid = config.Cmd.Process.Pid
+	}
+
+	var reattach *ReattachConfig
+	if rc := executorClient.ReattachConfig(); rc != nil {
+		reattach = NewReattachConfig(rc)
+	}
+
+	return &ExecutorHandle{
+		Executor:  executorPlugin,
+		Client:    executorClient,
+		PluginPid: pluginPid,
+		Kill:      &ExecutorKillConfig{Signal: killSignal, DesiredTimeout: task.KillTimeout},
+		Reattach:  reattach,
+		closeLog:  closeLog,
+	}, nil
+}
+
+// ReattachConfig is a JSON-serializable form of plugin.ReattachConfig, fit
+// for persisting into a driver handle's state so that a still-running
+// executor plugin process can be reattached after a Nomad client restart
+// instead of being killed and relaunched.
+type ReattachConfig struct {
+	Network string
+	Addr    string
+	Pid     int
 }
 
-func createExecutorWithConfig(config *plugin.ClientConfig, w io.Writer) (executor.Executor, *plugin.Client, error) {
+// NewReattachConfig captures the address, network, and pid of a running
+// executor plugin so it can be persisted and later reattached via
+// reattachExecutor.
+func NewReattachConfig(c *plugin.ReattachConfig) *ReattachConfig {
+	return &ReattachConfig{
+		Network: c.Addr.Network(),
+		Addr:    c.Addr.String(),
+		Pid:     c.Pid,
+	}
+}
+
+// PluginConfig resolves the persisted address back into a plugin.ReattachConfig
+// that go-plugin can dial.
+func (r *ReattachConfig) PluginConfig() (*plugin.ReattachConfig, error) {
+	var addr net.Addr
+	var err error
+	switch r.Network {
+	case "unix", "unixgram", "unixpacket":
+		addr, err = net.ResolveUnixAddr(r.Network, r.Addr)
+	default:
+		addr, err = net.ResolveTCPAddr(r.Network, r.Addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error resolving reattach address %q: %v", r.Addr, err)
+	}
+
+	return &plugin.ReattachConfig{
+		Protocol: plugin.ProtocolNetRPC,
+		Pid:      r.Pid,
+		Addr:     addr,
+	}, nil
+}
+
+// reattachExecutor re-establishes an RPC connection to an executor plugin
+// process that is still running after a Nomad client restart, rather than
+// launching a fresh one. Callers that need the kill-orphan fallback the
+// request describes should go through ReattachOrDestroy instead of calling
+// this directly.
+func reattachExecutor(reattach *plugin.ReattachConfig, logger hclog.Logger, allocID string, task *structs.Task, clientConfig *config.Config) (*ExecutorHandle, error) {
+	killSignal, err := getTaskKillSignal(task.KillSignal)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kill signal: %v", err)
+	}
+
+	stdout, stderr, closeLog := executorLogWriters(logger, task.Name, allocID)
+
+	config := &plugin.ClientConfig{
+		Reattach:   reattach,
+		SyncStdout: stdout,
+		SyncStderr: stderr,
+	}
 	config.HandshakeConfig = pexecutor.HandshakeConfig
+	config.Plugins = pexecutor.GetPluginMap(stdout, hclog.LevelFromString(clientConfig.LogLevel), false)
+
+	executorClient := plugin.NewClient(config)
+	rpcClient, err := executorClient.Client()
+	if err != nil {
+		closeLog()
+		return nil, fmt.Errorf("error creating rpc client for executor plugin: %v", err)
+	}
+
+	raw, err := rpcClient.Dispense("executor")
+	if err != nil {
+		closeLog()
+		return nil, fmt.Errorf("unable to dispense the executor plugin: %v", err)
+	}
+	executorPlugin := raw.(executor.Executor)
+
+	return &ExecutorHandle{
+		Executor:  executorPlugin,
+		Client:    executorClient,
+		PluginPid: reattach.Pid,
+		Kill:      &ExecutorKillConfig{Signal: killSignal, DesiredTimeout: task.KillTimeout},
+		Reattach:  NewReattachConfig(reattach),
+		closeLog:  closeLog,
+	}, nil
+}
+
+// ReattachOrDestroy attempts to reattach to a previously launched executor
+// plugin described by reattach, so that a Nomad client restart doesn't
+// force the task to restart. If the process is gone or reattachment
+// otherwise fails, it falls back to destroying the orphaned plugin and
+// user process (userPid) so the caller can launch a fresh executor via
+// createExecutor instead.
+func ReattachOrDestroy(reattach *ReattachConfig, logger hclog.Logger, allocID string, task *structs.Task,
+	clientConfig *config.Config, userPid int) (*ExecutorHandle, error) {
+
+	pluginConfig, reattachErr := reattach.PluginConfig()
+	if reattachErr == nil {
+		var handle *ExecutorHandle
+		handle, reattachErr = reattachExecutor(pluginConfig, logger, allocID, task, clientConfig)
+		if reattachErr == nil {
+			return handle, nil
+		}
+	}
+
+	logger.Warn("failed to reattach to executor plugin, destroying orphaned process",
+		"error", reattachErr, "task_name", task.Name, "alloc_id", allocID)
+
+	killSignal, err := getTaskKillSignal(task.KillSignal)
+	if err != nil {
+		return nil, multierror.Append(reattachErr, err)
+	}
+	if destroyErr := destroyPlugin(reattach.Pid, userPid, killSignal, task.KillTimeout, clientConfig.MaxKillTimeout); destroyErr != nil {
+		return nil, multierror.Append(reattachErr, destroyErr)
+	}
+
+	return nil, reattachErr
+}
+
+// createExecutorWithConfig returns a close func alongside the executor RPC
+// client; callers must invoke it once the plugin exits to stop the
+// background goroutine bridging its log output.
+func createExecutorWithConfig(config *plugin.ClientConfig, logger hclog.Logger, taskName, allocID string) (executor.Executor, *plugin.Client, func(), error) {
+	config.HandshakeConfig = pexecutor.HandshakeConfig
+
+	stdout, stderr, closeLog := executorLogWriters(logger, taskName, allocID)
+	config.SyncStdout = stdout
+	config.SyncStderr = stderr
 
 	// Setting this to DEBUG since the log level at the executor server process
 	// is already set, and this effects only the executor client.
-	config.Plugins = pexecutor.GetPluginMap(w, hclog.Debug, false)
+	config.Plugins = pexecutor.GetPluginMap(stdout, hclog.Debug, false)
 
 	executorClient := plugin.NewClient(config)
 	rpcClient, err := executorClient.Client()
 	if err != nil {
-		return nil, nil, fmt.Errorf("error creating rpc client for executor plugin: %v", err)
+		closeLog()
+		return nil, nil, nil, fmt.Errorf("error creating rpc client for executor plugin: %v", err)
 	}
 
 	raw, err := rpcClient.Dispense("executor")
 	if err != nil {
-		return nil, nil, fmt.Errorf("unable to dispense the executor plugin: %v", err)
+		closeLog()
+		return nil, nil, nil, fmt.Errorf("unable to dispense the executor plugin: %v", err)
 	}
 	executorPlugin, ok := raw.(*pexecutor.ExecutorRPC)
 	if !ok {
-		return nil, nil, fmt.Errorf("unexpected executor rpc type: %T", raw)
+		closeLog()
+		return nil, nil, nil, fmt.Errorf("unexpected executor rpc type: %T", raw)
+	}
+	return executorPlugin, executorClient, closeLog, nil
+}
+
+// maxExecutorLogLineBytes bounds a single buffered executor log line.
+// bufio.Scanner's default 64KB cap would otherwise make Scan() return false
+// -- and the whole log bridge silently stop -- on the first oversized line.
+const maxExecutorLogLineBytes = 1 << 20 // 1MB
+
+// executorLogWriter returns an io.Writer that decodes each line written to
+// it as a JSON-formatted hclog entry -- the format the "nomad executor"
+// subprocess logs in -- and re-emits it through logger at the original
+// level, tagged with task_name, alloc_id, and the line's original
+// @timestamp. Lines that fail to decode are passed through unmodified at
+// Info level so nothing is lost. The returned close func must be called
+// once the executor plugin exits, or the background goroutine reading from
+// the pipe leaks for the life of the process.
+//
+// Each stream (stdout, stderr) needs its own writer: go-plugin copies them
+// from independent goroutines, and multiplexing both onto a single pipe
+// lets a line from one interleave with a line from the other mid-write,
+// corrupting the JSON the scanner below expects one line at a time.
+func executorLogWriter(logger hclog.Logger, taskName, allocID string) (io.Writer, func()) {
+	r, w := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxExecutorLogLineBytes)
+		for scanner.Scan() {
+			logExecutorLine(logger, taskName, allocID, scanner.Bytes())
+		}
+		if err := scanner.Err(); err != nil {
+			logger.Warn("executor log bridge stopped early", "task_name", taskName, "alloc_id", allocID, "error", err)
+		}
+	}()
+
+	return w, func() {
+		w.Close()
+		<-done
+	}
+}
+
+// executorLogWriters returns independent stdout and stderr writers, each
+// bridged to logger via its own executorLogWriter, and a single close func
+// that stops both. Passing separate writers to plugin.ClientConfig's
+// SyncStdout/SyncStderr keeps the two streams from interleaving at a shared
+// pipe before the scanner gets a chance to split them into lines.
+func executorLogWriters(logger hclog.Logger, taskName, allocID string) (stdout, stderr io.Writer, closeLogs func()) {
+	stdout, closeStdout := executorLogWriter(logger, taskName, allocID)
+	stderr, closeStderr := executorLogWriter(logger, taskName, allocID)
+	return stdout, stderr, func() {
+		closeStdout()
+		closeStderr()
+	}
+}
+
+// logExecutorLine decodes a single JSON-formatted hclog entry emitted by the
+// executor subprocess and re-emits it through logger, surfacing the line's
+// original @timestamp as a field since logger.Log always stamps the current
+// time.
+func logExecutorLine(logger hclog.Logger, taskName, allocID string, line []byte) {
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		logger.Info(string(line), "task_name", taskName, "alloc_id", allocID)
+		return
+	}
+
+	level := hclog.Info
+	if lvl, ok := fields["@level"].(string); ok {
+		level = hclog.LevelFromString(lvl)
+	}
+	msg, _ := fields["@message"].(string)
+	delete(fields, "@level")
+	delete(fields, "@message")
+	delete(fields, "@module")
+	if ts, ok := fields["@timestamp"]; ok {
+		delete(fields, "@timestamp")
+		fields["timestamp"] = ts
 	}
-	return executorPlugin, executorClient, nil
+
+	args := make([]interface{}, 0, 2*(len(fields)+2))
+	args = append(args, "task_name", taskName, "alloc_id", allocID)
+	for k, v := range fields {
+		args = append(args, k, v)
+	}
+
+	logger.Log(level, msg, args...)
 }
 
 // killProcess kills a process with the given pid
@@ -104,15 +394,52 @@ func killProcess(pid int) error {
 	return proc.Kill()
 }
 
-// destroyPlugin kills the plugin with the given pid and also kills the user
-// process
-func destroyPlugin(pluginPid int, userPid int) error {
+// processExitPollInterval is how often terminateProcess checks whether the
+// signaled process has exited while it waits out the kill timeout.
+const processExitPollInterval = 100 * time.Millisecond
+
+// terminateProcess sends sig to the process with the given pid and waits up
+// to timeout for it to exit, polling by signaling 0 to the process. If the
+// process has not exited by the deadline it is escalated to SIGKILL.
+func terminateProcess(pid int, sig os.Signal, timeout time.Duration) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	if err := proc.Signal(sig); err != nil {
+		// The process may have already exited.
+		if err == os.ErrProcessDone {
+			return nil
+		}
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if err := proc.Signal(syscall.Signal(0)); err != nil {
+			// The process is gone.
+			return nil
+		}
+		time.Sleep(processExitPollInterval)
+	}
+
+	return proc.Kill()
+}
+
+// destroyPlugin kills the plugin with the given pid and gracefully
+// terminates the user process. The user process is sent killSignal and
+// given GetKillTimeout(desiredTimeout, maxTimeout) to exit on its own
+// before being escalated to SIGKILL. The plugin itself is always killed
+// immediately since it has no task state of its own to flush.
+func destroyPlugin(pluginPid int, userPid int, killSignal os.Signal, desiredTimeout, maxTimeout time.Duration) error {
 	var merr error
 	if err := killProcess(pluginPid); err != nil {
 		merr = multierror.Append(merr, err)
 	}
 
-	if err := killProcess(userPid); err != nil {
+	killTimeout := GetKillTimeout(desiredTimeout, maxTimeout)
+	if err := terminateProcess(userPid, killSignal, killTimeout); err != nil {
 		merr = multierror.Append(merr, err)
 	}
 	return merr